@@ -0,0 +1,101 @@
+// Copyright 2023 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpconnect
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStreamConn adapts a net.Conn half of a net.Pipe to transport.StreamConn.
+type fakeStreamConn struct {
+	net.Conn
+}
+
+func (c *fakeStreamConn) CloseWrite() error { return nil }
+
+type fakeStreamEndpoint struct {
+	conn transport.StreamConn
+}
+
+func (e *fakeStreamEndpoint) Connect(ctx context.Context) (transport.StreamConn, error) {
+	return e.conn, nil
+}
+
+func TestDialStream(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		req, err := http.ReadRequest(bufio.NewReader(server))
+		require.NoError(t, err)
+		require.Equal(t, http.MethodConnect, req.Method)
+		require.Equal(t, "example.com:443", req.Host)
+		resp := &http.Response{StatusCode: http.StatusOK, ProtoMajor: 1, ProtoMinor: 1, Header: make(http.Header)}
+		require.NoError(t, resp.Write(server))
+	}()
+
+	dialer, err := NewStreamDialer(&fakeStreamEndpoint{conn: &fakeStreamConn{Conn: client}}, "", "")
+	require.NoError(t, err)
+	conn, err := dialer.DialStream(context.Background(), "example.com:443")
+	require.NoError(t, err)
+	require.NotNil(t, conn)
+}
+
+func TestDialStream_BasicAuth(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		req, err := http.ReadRequest(bufio.NewReader(server))
+		require.NoError(t, err)
+		username, password, ok := req.BasicAuth()
+		require.True(t, ok)
+		require.Equal(t, "user", username)
+		require.Equal(t, "pass", password)
+		resp := &http.Response{StatusCode: http.StatusOK, ProtoMajor: 1, ProtoMinor: 1, Header: make(http.Header)}
+		require.NoError(t, resp.Write(server))
+	}()
+
+	dialer, err := NewStreamDialer(&fakeStreamEndpoint{conn: &fakeStreamConn{Conn: client}}, "user", "pass")
+	require.NoError(t, err)
+	_, err = dialer.DialStream(context.Background(), "example.com:443")
+	require.NoError(t, err)
+}
+
+func TestDialStream_NonOKStatus(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		_, err := http.ReadRequest(bufio.NewReader(server))
+		require.NoError(t, err)
+		resp := &http.Response{StatusCode: http.StatusForbidden, ProtoMajor: 1, ProtoMinor: 1, Header: make(http.Header)}
+		require.NoError(t, resp.Write(server))
+	}()
+
+	dialer, err := NewStreamDialer(&fakeStreamEndpoint{conn: &fakeStreamConn{Conn: client}}, "", "")
+	require.NoError(t, err)
+	_, err = dialer.DialStream(context.Background(), "example.com:443")
+	require.Error(t, err)
+}
+
+func TestNewStreamDialer_NilEndpoint(t *testing.T) {
+	_, err := NewStreamDialer(nil, "", "")
+	require.Error(t, err)
+}
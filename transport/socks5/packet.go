@@ -0,0 +1,201 @@
+// Copyright 2023 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package socks5
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// packetListener implements SOCKS5 UDP ASSOCIATE (RFC 1928, Section 7). Each call to
+// ListenPacket opens a TCP control connection to keep the association alive for the lifetime of
+// the returned net.PacketConn, and a UDP socket to the relay address the proxy assigns.
+type packetListener struct {
+	controlEndpoint transport.StreamEndpoint
+	packetDialer    transport.PacketDialer
+	creds           *Credentials
+}
+
+var _ transport.PacketListener = (*packetListener)(nil)
+
+// NewPacketListener creates a transport.PacketListener that relays datagrams through the SOCKS5
+// proxy reached via controlEndpoint, using packetDialer to reach the UDP relay address the proxy
+// assigns during the UDP ASSOCIATE handshake.
+func NewPacketListener(controlEndpoint transport.StreamEndpoint, packetDialer transport.PacketDialer, creds *Credentials) (transport.PacketListener, error) {
+	if controlEndpoint == nil || packetDialer == nil {
+		return nil, errors.New("control endpoint and packet dialer must not be nil")
+	}
+	return &packetListener{controlEndpoint, packetDialer, creds}, nil
+}
+
+func (l *packetListener) ListenPacket(ctx context.Context) (net.PacketConn, error) {
+	ctrlConn, err := l.controlEndpoint.Connect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SOCKS5 proxy: %w", err)
+	}
+	if err := negotiateAuth(ctrlConn, l.creds); err != nil {
+		ctrlConn.Close()
+		return nil, fmt.Errorf("failed SOCKS5 authentication: %w", err)
+	}
+	// The client's own address is unknown yet, so we request association for 0.0.0.0:0, as
+	// allowed by RFC 1928, Section 7.
+	relayAddr, err := request(ctrlConn, cmdUDPAssociate, "0.0.0.0:0")
+	if err != nil {
+		ctrlConn.Close()
+		return nil, fmt.Errorf("failed SOCKS5 UDP ASSOCIATE: %w", err)
+	}
+	relayAddr, err = resolveRelayAddr(relayAddr, ctrlConn.RemoteAddr())
+	if err != nil {
+		ctrlConn.Close()
+		return nil, fmt.Errorf("failed to resolve SOCKS5 UDP relay address: %w", err)
+	}
+	relayConn, err := l.packetDialer.DialPacket(ctx, relayAddr)
+	if err != nil {
+		ctrlConn.Close()
+		return nil, fmt.Errorf("failed to reach SOCKS5 UDP relay at %s: %w", relayAddr, err)
+	}
+	return &packetConn{relayConn: relayConn, ctrlConn: ctrlConn}, nil
+}
+
+// resolveRelayAddr substitutes the host of ctrlAddr (the control connection's remote address)
+// into relayAddr when the proxy's BND.ADDR is the unspecified address (0.0.0.0 or ::), which
+// RFC 1928 doesn't define but real SOCKS5 servers use to mean "the same host you're already
+// talking to", not literally address 0.0.0.0. Dialing 0.0.0.0 verbatim resolves to localhost and
+// silently breaks the relay against any non-local proxy.
+func resolveRelayAddr(relayAddr string, ctrlAddr net.Addr) (string, error) {
+	host, port, err := net.SplitHostPort(relayAddr)
+	if err != nil {
+		return "", fmt.Errorf("invalid relay address %q: %w", relayAddr, err)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsUnspecified() {
+		return relayAddr, nil
+	}
+	ctrlHost, _, err := net.SplitHostPort(ctrlAddr.String())
+	if err != nil {
+		return "", fmt.Errorf("invalid control connection address %q: %w", ctrlAddr, err)
+	}
+	return net.JoinHostPort(ctrlHost, port), nil
+}
+
+// packetConn is a net.PacketConn that wraps every datagram in the SOCKS5 UDP request header
+// (RFC 1928, Section 7) before sending it to the relay, and strips it from datagrams read back.
+// Closing it tears down both the relay socket and the control connection that keeps the
+// association alive.
+type packetConn struct {
+	relayConn net.Conn
+	ctrlConn  io.Closer
+}
+
+var _ net.PacketConn = (*packetConn)(nil)
+
+func (c *packetConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	header, err := appendAddr([]byte{0x00, 0x00, 0x00}, addr.String())
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode UDP relay header: %w", err)
+	}
+	packet := append(header, p...)
+	n, err := c.relayConn.Write(packet)
+	written := n - len(header)
+	if written < 0 {
+		written = 0
+	}
+	return written, err
+}
+
+func (c *packetConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	buf := make([]byte, len(p)+maxUDPHeaderSize)
+	n, err := c.relayConn.Read(buf)
+	if err != nil {
+		return 0, nil, err
+	}
+	addrStr, payload, err := parseUDPDatagram(buf[:n])
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to parse UDP relay header: %w", err)
+	}
+	addr, err := net.ResolveUDPAddr("udp", addrStr)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to resolve origin address %q: %w", addrStr, err)
+	}
+	return copy(p, payload), addr, nil
+}
+
+func (c *packetConn) Close() error {
+	relayErr := c.relayConn.Close()
+	ctrlErr := c.ctrlConn.Close()
+	if relayErr != nil {
+		return relayErr
+	}
+	return ctrlErr
+}
+
+func (c *packetConn) LocalAddr() net.Addr               { return c.relayConn.LocalAddr() }
+func (c *packetConn) SetDeadline(t time.Time) error      { return c.relayConn.SetDeadline(t) }
+func (c *packetConn) SetReadDeadline(t time.Time) error  { return c.relayConn.SetReadDeadline(t) }
+func (c *packetConn) SetWriteDeadline(t time.Time) error { return c.relayConn.SetWriteDeadline(t) }
+
+// maxUDPHeaderSize is large enough for the largest SOCKS5 UDP header: 3 (RSV+FRAG) + 1 (ATYP) +
+// 1 (domain length) + 255 (domain) + 2 (port).
+const maxUDPHeaderSize = 3 + 1 + 1 + 255 + 2
+
+// parseUDPDatagram parses a SOCKS5 UDP relay datagram (RFC 1928, Section 7), returning the origin
+// "host:port" and the payload. Fragmented datagrams (FRAG != 0) aren't supported.
+func parseUDPDatagram(data []byte) (addr string, payload []byte, err error) {
+	if len(data) < 4 {
+		return "", nil, errors.New("datagram too short")
+	}
+	if data[2] != 0x00 {
+		return "", nil, errors.New("fragmented UDP datagrams are not supported")
+	}
+	rest := data[3:]
+	if len(rest) < 1 {
+		return "", nil, errors.New("datagram too short")
+	}
+	var host string
+	switch rest[0] {
+	case atypIPv4:
+		if len(rest) < 1+net.IPv4len+2 {
+			return "", nil, errors.New("datagram too short for IPv4 address")
+		}
+		host = net.IP(rest[1 : 1+net.IPv4len]).String()
+		rest = rest[1+net.IPv4len:]
+	case atypIPv6:
+		if len(rest) < 1+net.IPv6len+2 {
+			return "", nil, errors.New("datagram too short for IPv6 address")
+		}
+		host = net.IP(rest[1 : 1+net.IPv6len]).String()
+		rest = rest[1+net.IPv6len:]
+	case atypDomain:
+		if len(rest) < 2 {
+			return "", nil, errors.New("datagram too short for domain length")
+		}
+		domainLen := int(rest[1])
+		if len(rest) < 2+domainLen+2 {
+			return "", nil, errors.New("datagram too short for domain address")
+		}
+		host = string(rest[2 : 2+domainLen])
+		rest = rest[2+domainLen:]
+	default:
+		return "", nil, fmt.Errorf("unsupported address type %d", rest[0])
+	}
+	port := int(rest[0])<<8 | int(rest[1])
+	return net.JoinHostPort(host, fmt.Sprint(port)), rest[2:], nil
+}
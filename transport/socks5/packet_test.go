@@ -0,0 +1,92 @@
+// Copyright 2023 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package socks5
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUDPDatagram(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        []byte
+		wantAddr    string
+		wantPayload []byte
+	}{
+		{
+			name:        "ipv4",
+			data:        []byte{0x00, 0x00, 0x00, atypIPv4, 192, 0, 2, 1, 0, 80, 'h', 'i'},
+			wantAddr:    "192.0.2.1:80",
+			wantPayload: []byte("hi"),
+		},
+		{
+			name:        "domain",
+			data:        append([]byte{0x00, 0x00, 0x00, atypDomain, 11}, append([]byte("example.com"), 0x01, 0xbb, 'x')...),
+			wantAddr:    "example.com:443",
+			wantPayload: []byte("x"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, payload, err := parseUDPDatagram(tt.data)
+			require.NoError(t, err)
+			require.Equal(t, tt.wantAddr, addr)
+			require.Equal(t, tt.wantPayload, payload)
+		})
+	}
+}
+
+func TestParseUDPDatagram_Fragmented(t *testing.T) {
+	data := []byte{0x00, 0x00, 0x01, atypIPv4, 192, 0, 2, 1, 0, 80}
+	_, _, err := parseUDPDatagram(data)
+	require.Error(t, err)
+}
+
+func TestParseUDPDatagram_TooShort(t *testing.T) {
+	tests := [][]byte{
+		{},
+		{0x00, 0x00},
+		{0x00, 0x00, 0x00},
+		{0x00, 0x00, 0x00, atypIPv4, 192, 0, 2},
+	}
+	for _, data := range tests {
+		_, _, err := parseUDPDatagram(data)
+		require.Error(t, err)
+	}
+}
+
+func TestResolveRelayAddr_UnspecifiedIPv4(t *testing.T) {
+	ctrlAddr := &net.TCPAddr{IP: net.ParseIP("203.0.113.5"), Port: 1080}
+	got, err := resolveRelayAddr("0.0.0.0:51820", ctrlAddr)
+	require.NoError(t, err)
+	require.Equal(t, "203.0.113.5:51820", got)
+}
+
+func TestResolveRelayAddr_UnspecifiedIPv6(t *testing.T) {
+	ctrlAddr := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1080}
+	got, err := resolveRelayAddr("[::]:51820", ctrlAddr)
+	require.NoError(t, err)
+	require.Equal(t, "[2001:db8::1]:51820", got)
+}
+
+func TestResolveRelayAddr_AlreadySpecific(t *testing.T) {
+	ctrlAddr := &net.TCPAddr{IP: net.ParseIP("203.0.113.5"), Port: 1080}
+	got, err := resolveRelayAddr("198.51.100.2:51820", ctrlAddr)
+	require.NoError(t, err)
+	require.Equal(t, "198.51.100.2:51820", got)
+}
@@ -0,0 +1,265 @@
+// Copyright 2023 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package socks5 implements a client for the SOCKS5 proxy protocol (RFC 1928), with optional
+// username/password authentication (RFC 1929). It exposes the upstream proxy as a
+// transport.StreamDialer and transport.PacketListener, so it composes with the rest of the SDK like
+// any other dialer.
+package socks5
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+const socks5Version = 0x05
+
+// Authentication methods, as defined in RFC 1928, Section 3.
+const (
+	authNone         = 0x00
+	authPassword     = 0x02
+	authNoAcceptable = 0xFF
+)
+
+const passwordAuthVersion = 0x01
+
+// Commands, as defined in RFC 1928, Section 4.
+const (
+	cmdConnect      = 0x01
+	cmdUDPAssociate = 0x03
+)
+
+// Address types, as defined in RFC 1928, Section 5.
+const (
+	atypIPv4   = 0x01
+	atypDomain = 0x03
+	atypIPv6   = 0x04
+)
+
+// Credentials holds the username and password sent during SOCKS5 authentication (RFC 1929). A nil
+// *Credentials means no authentication is attempted.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// replyError maps a SOCKS5 reply code (RFC 1928, Section 6) to a human-readable error.
+func replyError(code byte) error {
+	reasons := map[byte]string{
+		0x01: "general SOCKS server failure",
+		0x02: "connection not allowed by ruleset",
+		0x03: "network unreachable",
+		0x04: "host unreachable",
+		0x05: "connection refused",
+		0x06: "TTL expired",
+		0x07: "command not supported",
+		0x08: "address type not supported",
+	}
+	if reason, ok := reasons[code]; ok {
+		return fmt.Errorf("SOCKS5 server error: %s", reason)
+	}
+	return fmt.Errorf("SOCKS5 server error: unknown reply code %d", code)
+}
+
+// negotiateAuth performs the SOCKS5 method negotiation and, if required, username/password
+// authentication, as defined in RFC 1928 and RFC 1929.
+func negotiateAuth(conn io.ReadWriter, creds *Credentials) error {
+	methods := []byte{authNone}
+	if creds != nil {
+		methods = append(methods, authPassword)
+	}
+	request := append([]byte{socks5Version, byte(len(methods))}, methods...)
+	if _, err := conn.Write(request); err != nil {
+		return fmt.Errorf("failed to send method negotiation: %w", err)
+	}
+	response := make([]byte, 2)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return fmt.Errorf("failed to read method negotiation response: %w", err)
+	}
+	if response[0] != socks5Version {
+		return fmt.Errorf("unexpected SOCKS version %d", response[0])
+	}
+	switch response[1] {
+	case authNone:
+		return nil
+	case authPassword:
+		if creds == nil {
+			return errors.New("server requires username/password authentication")
+		}
+		return authenticatePassword(conn, creds)
+	case authNoAcceptable:
+		return errors.New("no acceptable authentication method")
+	default:
+		return fmt.Errorf("unexpected authentication method %d", response[1])
+	}
+}
+
+func authenticatePassword(conn io.ReadWriter, creds *Credentials) error {
+	if len(creds.Username) > 255 || len(creds.Password) > 255 {
+		return errors.New("username and password must be at most 255 bytes each")
+	}
+	request := make([]byte, 0, 3+len(creds.Username)+len(creds.Password))
+	request = append(request, passwordAuthVersion, byte(len(creds.Username)))
+	request = append(request, creds.Username...)
+	request = append(request, byte(len(creds.Password)))
+	request = append(request, creds.Password...)
+	if _, err := conn.Write(request); err != nil {
+		return fmt.Errorf("failed to send credentials: %w", err)
+	}
+	response := make([]byte, 2)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return fmt.Errorf("failed to read authentication response: %w", err)
+	}
+	if response[1] != 0x00 {
+		return errors.New("authentication failed")
+	}
+	return nil
+}
+
+// appendAddr appends the SOCKS5 address encoding of addr (RFC 1928, Section 5) to buf.
+func appendAddr(buf []byte, addr string) ([]byte, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	port, err := net.LookupPort("tcp", portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port in %q: %w", addr, err)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			buf = append(buf, atypIPv4)
+			buf = append(buf, ip4...)
+		} else {
+			buf = append(buf, atypIPv6)
+			buf = append(buf, ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return nil, fmt.Errorf("domain name too long: %q", host)
+		}
+		buf = append(buf, atypDomain, byte(len(host)))
+		buf = append(buf, host...)
+	}
+	return append(buf, byte(port>>8), byte(port)), nil
+}
+
+// request sends a SOCKS5 request with the given command and target address, and reads back the
+// server's reply. On success, it returns the bound address the server reports (host:port).
+func request(conn io.ReadWriter, cmd byte, addr string) (string, error) {
+	req := []byte{socks5Version, cmd, 0x00}
+	req, err := appendAddr(req, addr)
+	if err != nil {
+		return "", err
+	}
+	if _, err := conn.Write(req); err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	header := make([]byte, 3)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", fmt.Errorf("failed to read reply header: %w", err)
+	}
+	if header[0] != socks5Version {
+		return "", fmt.Errorf("unexpected SOCKS version %d in reply", header[0])
+	}
+	if header[1] != 0x00 {
+		return "", replyError(header[1])
+	}
+	boundAddr, err := readBoundAddr(conn)
+	if err != nil {
+		return "", err
+	}
+	return boundAddr, nil
+}
+
+// readBoundAddr reads the BND.ADDR/BND.PORT fields of a reply and returns them as "host:port".
+func readBoundAddr(r io.Reader) (string, error) {
+	atyp := make([]byte, 1)
+	if _, err := io.ReadFull(r, atyp); err != nil {
+		return "", fmt.Errorf("failed to read bound address type: %w", err)
+	}
+	var host string
+	switch atyp[0] {
+	case atypIPv4:
+		ip := make([]byte, net.IPv4len)
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", fmt.Errorf("failed to read bound IPv4 address: %w", err)
+		}
+		host = net.IP(ip).String()
+	case atypIPv6:
+		ip := make([]byte, net.IPv6len)
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", fmt.Errorf("failed to read bound IPv6 address: %w", err)
+		}
+		host = net.IP(ip).String()
+	case atypDomain:
+		lenByte := make([]byte, 1)
+		if _, err := io.ReadFull(r, lenByte); err != nil {
+			return "", fmt.Errorf("failed to read bound domain length: %w", err)
+		}
+		domain := make([]byte, lenByte[0])
+		if _, err := io.ReadFull(r, domain); err != nil {
+			return "", fmt.Errorf("failed to read bound domain: %w", err)
+		}
+		host = string(domain)
+	default:
+		return "", fmt.Errorf("unsupported bound address type %d", atyp[0])
+	}
+	portBytes := make([]byte, 2)
+	if _, err := io.ReadFull(r, portBytes); err != nil {
+		return "", fmt.Errorf("failed to read bound port: %w", err)
+	}
+	port := int(portBytes[0])<<8 | int(portBytes[1])
+	return net.JoinHostPort(host, fmt.Sprint(port)), nil
+}
+
+type streamDialer struct {
+	proxy transport.StreamEndpoint
+	creds *Credentials
+}
+
+var _ transport.StreamDialer = (*streamDialer)(nil)
+
+// NewStreamDialer creates a transport.StreamDialer that tunnels through the SOCKS5 proxy reached
+// via proxyEndpoint, issuing a CONNECT request for each dial. If creds is non-nil, it's used for
+// username/password authentication (RFC 1929).
+func NewStreamDialer(proxyEndpoint transport.StreamEndpoint, creds *Credentials) (transport.StreamDialer, error) {
+	if proxyEndpoint == nil {
+		return nil, errors.New("proxy endpoint must not be nil")
+	}
+	return &streamDialer{proxy: proxyEndpoint, creds: creds}, nil
+}
+
+func (d *streamDialer) DialStream(ctx context.Context, addr string) (transport.StreamConn, error) {
+	// ConnectStart/ConnectDone describe the network dial to addr, which this dialer never makes
+	// itself; d.proxy.Connect dials the proxy, and whichever dialer is innermost fires the trace.
+	conn, err := d.proxy.Connect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SOCKS5 proxy: %w", err)
+	}
+	if err := negotiateAuth(conn, d.creds); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed SOCKS5 authentication: %w", err)
+	}
+	if _, err := request(conn, cmdConnect, addr); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed SOCKS5 CONNECT to %s: %w", addr, err)
+	}
+	return conn, nil
+}
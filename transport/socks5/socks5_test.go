@@ -0,0 +1,174 @@
+// Copyright 2023 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package socks5
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedConn is an io.ReadWriter that returns a canned server response and records everything
+// written to it, for testing the request/response exchanges in this package without a real
+// SOCKS5 server.
+type scriptedConn struct {
+	written bytes.Buffer
+	toRead  *bytes.Reader
+}
+
+func newScriptedConn(response []byte) *scriptedConn {
+	return &scriptedConn{toRead: bytes.NewReader(response)}
+}
+
+func (c *scriptedConn) Write(p []byte) (int, error) { return c.written.Write(p) }
+func (c *scriptedConn) Read(p []byte) (int, error)  { return c.toRead.Read(p) }
+
+func TestNegotiateAuth_NoneRequired(t *testing.T) {
+	conn := newScriptedConn([]byte{socks5Version, authNone})
+	err := negotiateAuth(conn, nil)
+	require.NoError(t, err)
+	require.Equal(t, []byte{socks5Version, 1, authNone}, conn.written.Bytes())
+}
+
+func TestNegotiateAuth_Password(t *testing.T) {
+	conn := newScriptedConn([]byte{socks5Version, authPassword, passwordAuthVersion, 0x00})
+	creds := &Credentials{Username: "user", Password: "pass"}
+	err := negotiateAuth(conn, creds)
+	require.NoError(t, err)
+	require.Equal(t, []byte{socks5Version, 2, authNone, authPassword}, conn.written.Bytes()[:4])
+	require.Equal(t, []byte{passwordAuthVersion, 4, 'u', 's', 'e', 'r', 4, 'p', 'a', 's', 's'}, conn.written.Bytes()[4:])
+}
+
+func TestNegotiateAuth_PasswordRequiredButNoCreds(t *testing.T) {
+	conn := newScriptedConn([]byte{socks5Version, authPassword})
+	err := negotiateAuth(conn, nil)
+	require.Error(t, err)
+}
+
+func TestNegotiateAuth_PasswordRejected(t *testing.T) {
+	conn := newScriptedConn([]byte{socks5Version, authPassword, passwordAuthVersion, 0x01})
+	err := negotiateAuth(conn, &Credentials{Username: "user", Password: "pass"})
+	require.Error(t, err)
+}
+
+func TestNegotiateAuth_NoAcceptableMethod(t *testing.T) {
+	conn := newScriptedConn([]byte{socks5Version, authNoAcceptable})
+	err := negotiateAuth(conn, nil)
+	require.Error(t, err)
+}
+
+func TestNegotiateAuth_WrongVersion(t *testing.T) {
+	conn := newScriptedConn([]byte{0x04, authNone})
+	err := negotiateAuth(conn, nil)
+	require.Error(t, err)
+}
+
+func TestAppendAddr(t *testing.T) {
+	tests := []struct {
+		name string
+		addr string
+		want []byte
+	}{
+		{name: "ipv4", addr: "192.0.2.1:80", want: []byte{atypIPv4, 192, 0, 2, 1, 0, 80}},
+		{name: "ipv6", addr: "[2001:db8::1]:443", want: append([]byte{atypIPv6}, append(net.ParseIP("2001:db8::1").To16(), 1, 187)...)},
+		{name: "domain", addr: "example.com:8080", want: append([]byte{atypDomain, 11}, append([]byte("example.com"), 0x1f, 0x90)...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := appendAddr(nil, tt.addr)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAppendAddr_DomainTooLong(t *testing.T) {
+	longHost := string(bytes.Repeat([]byte("a"), 256))
+	_, err := appendAddr(nil, net.JoinHostPort(longHost, "80"))
+	require.Error(t, err)
+}
+
+func TestAppendAddr_InvalidAddress(t *testing.T) {
+	_, err := appendAddr(nil, "not-a-valid-addr")
+	require.Error(t, err)
+}
+
+func TestReadBoundAddr(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{name: "ipv4", data: []byte{atypIPv4, 203, 0, 113, 5, 0x1f, 0x90}, want: "203.0.113.5:8080"},
+		{name: "domain", data: append([]byte{atypDomain, 11}, append([]byte("example.com"), 0x01, 0xbb)...), want: "example.com:443"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readBoundAddr(bytes.NewReader(tt.data))
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRequest_ReplyError(t *testing.T) {
+	response := []byte{socks5Version, 0x05, 0x00} // connection refused
+	conn := newScriptedConn(response)
+	_, err := request(conn, cmdConnect, "example.com:443")
+	require.ErrorContains(t, err, "connection refused")
+}
+
+// fakeStreamConn adapts a scriptedConn to transport.StreamConn for exercising DialStream.
+type fakeStreamConn struct {
+	*scriptedConn
+}
+
+func (c *fakeStreamConn) Close() error                       { return nil }
+func (c *fakeStreamConn) CloseWrite() error                  { return nil }
+func (c *fakeStreamConn) LocalAddr() net.Addr                { return nil }
+func (c *fakeStreamConn) RemoteAddr() net.Addr               { return nil }
+func (c *fakeStreamConn) SetDeadline(t time.Time) error      { return nil }
+func (c *fakeStreamConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *fakeStreamConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type fakeStreamEndpoint struct {
+	conn *fakeStreamConn
+}
+
+func (e *fakeStreamEndpoint) Connect(ctx context.Context) (transport.StreamConn, error) {
+	return e.conn, nil
+}
+
+func TestStreamDialer_DialStream(t *testing.T) {
+	// Method negotiation reply (no auth), then CONNECT reply with BND.ADDR 0.0.0.0:0.
+	response := []byte{socks5Version, authNone, socks5Version, 0x00, 0x00, atypIPv4, 0, 0, 0, 0, 0, 0}
+	conn := &fakeStreamConn{scriptedConn: newScriptedConn(response)}
+	dialer, err := NewStreamDialer(&fakeStreamEndpoint{conn: conn}, nil)
+	require.NoError(t, err)
+
+	got, err := dialer.DialStream(context.Background(), "example.com:443")
+	require.NoError(t, err)
+	require.Same(t, transport.StreamConn(conn), got)
+}
+
+func TestStreamDialer_NilEndpoint(t *testing.T) {
+	_, err := NewStreamDialer(nil, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,66 @@
+// Copyright 2023 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package trace lets callers observe what happens as a connection is established through the
+// SDK's dialers. It defines callbacks for DNS resolution, connects, the Shadowsocks handshake and
+// the outgoing TLS ClientHello. It's modeled after net/http/httptrace: a Tracer holding optional callbacks is
+// attached to a context.Context with WithTracer, and the instrumented dialers look it up and
+// invoke whichever callbacks are set.
+package trace
+
+import "context"
+
+// Tracer holds the callbacks invoked by instrumented dialers as a connection is established. Any
+// field left nil is simply not called. All callbacks may be called from a goroutine other than
+// the one that made the dial call, and must not block.
+//
+// ConnectStart and ConnectDone are invoked by the direct TCP and UDP dialers at the base of an
+// x/config dialer chain, and TLSClientHello by the x/config tlsfrag dialer. No dialer in the SDK
+// invokes DNSStart, DNSDone or ShadowsocksHandshake.
+type Tracer struct {
+	// DNSStart is called before a DNS lookup for addr.
+	DNSStart func(addr string)
+	// DNSDone is called after a DNS lookup for addr completes, with the error, if any.
+	DNSDone func(addr string, err error)
+	// ConnectStart is called before dialing addr over network ("tcp" or "udp").
+	ConnectStart func(network, addr string)
+	// ConnectDone is called once the dial to addr over network completes, with the error, if
+	// any.
+	ConnectDone func(network, addr string, err error)
+	// ShadowsocksHandshake is called after the Shadowsocks salt and header have been written to
+	// addr, with the error, if any.
+	ShadowsocksHandshake func(addr string, err error)
+	// TLSClientHello is called the first time a connection from a tlsfrag dialer is written to,
+	// with the host of the dialed address and the prefix length chosen for the split. It's called
+	// whether or not tlsrecordfrag actually splits that first record.
+	TLSClientHello func(serverName string, prefixBytes int32)
+}
+
+type contextKey struct{}
+
+// WithTracer returns a copy of ctx with tracer attached, so that dialers instrumented with this
+// package will invoke its callbacks for operations done with the returned context.
+func WithTracer(ctx context.Context, tracer *Tracer) context.Context {
+	return context.WithValue(ctx, contextKey{}, tracer)
+}
+
+// FromContext returns the Tracer attached to ctx with WithTracer, or an empty Tracer (whose
+// callbacks are all nil) if none was attached. It never returns nil, so callers can invoke its
+// callback fields directly after a nil check on the field.
+func FromContext(ctx context.Context) *Tracer {
+	if tracer, ok := ctx.Value(contextKey{}).(*Tracer); ok && tracer != nil {
+		return tracer
+	}
+	return &Tracer{}
+}
@@ -0,0 +1,170 @@
+// Copyright 2023 Jigsaw Operations LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config provides functions to create Outline transport objects
+// (transport.StreamDialer, transport.PacketDialer) based on a text config,
+// so they can be created from a configuration file or command-line flag
+// without the caller having to know about every transport in the SDK.
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/transport/trace"
+)
+
+// NewStreamDialer creates a transport.StreamDialer according to transportConfig, which is a
+// "|"-separated list of transport configs, like "tlsfrag:5|ss://...", applied in order from the
+// outermost to the innermost: the first config dials the network, and each subsequent one wraps
+// the dialer created by the previous one. An empty config returns a direct TCP dialer.
+func NewStreamDialer(transportConfig string) (transport.StreamDialer, error) {
+	var dialer transport.StreamDialer = &tcpDialer{}
+	configs, err := parseConfigChain(transportConfig)
+	if err != nil {
+		return nil, err
+	}
+	for _, config := range configs {
+		dialer, err = wrapStreamDialer(dialer, config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create dialer for config %v: %w", config.Scheme, err)
+		}
+	}
+	return dialer, nil
+}
+
+// NewPacketDialer creates a transport.PacketDialer according to transportConfig, following the
+// same "|"-separated chaining rules as NewStreamDialer. An empty config returns a direct UDP
+// dialer.
+func NewPacketDialer(transportConfig string) (transport.PacketDialer, error) {
+	var dialer transport.PacketDialer = &udpDialer{}
+	configs, err := parseConfigChain(transportConfig)
+	if err != nil {
+		return nil, err
+	}
+	// Some packet transports (like socks5's UDP ASSOCIATE) need a TCP control connection. It's
+	// built by applying the config chain up to, but not including, the step currently being
+	// wrapped, so the control connection reaches the previous hop directly instead of dialing
+	// through the very dialer it's being used to construct.
+	var controlStreamDialer transport.StreamDialer = &tcpDialer{}
+	for _, config := range configs {
+		dialer, err = wrapPacketDialer(controlStreamDialer, dialer, config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create packet dialer for config %v: %w", config.Scheme, err)
+		}
+		controlStreamDialer, err = wrapStreamDialer(controlStreamDialer, config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create dialer for config %v: %w", config.Scheme, err)
+		}
+	}
+	return dialer, nil
+}
+
+// parseConfigChain splits a "|"-separated transportConfig into its individual config URLs, in
+// the order they should be applied.
+func parseConfigChain(transportConfig string) ([]*url.URL, error) {
+	transportConfig = strings.TrimSpace(transportConfig)
+	if len(transportConfig) == 0 {
+		return nil, nil
+	}
+	parts := strings.Split(transportConfig, "|")
+	configs := make([]*url.URL, 0, len(parts))
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if len(part) == 0 {
+			return nil, errors.New("empty config part")
+		}
+		configURL, err := url.Parse(part)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse config part %q: %w", part, err)
+		}
+		configs = append(configs, configURL)
+	}
+	return configs, nil
+}
+
+func wrapStreamDialer(innerDialer transport.StreamDialer, configURL *url.URL) (transport.StreamDialer, error) {
+	switch strings.ToLower(configURL.Scheme) {
+	case "ss":
+		return newShadowsocksStreamDialerFromURL(innerDialer, configURL)
+	case "tlsfrag":
+		return newTLSFragStreamDialerFromURL(innerDialer, configURL)
+	case "httpfrag":
+		return newHTTPFragStreamDialerFromURL(innerDialer, configURL)
+	case "socks5":
+		return newSOCKS5StreamDialerFromURL(innerDialer, configURL)
+	case "http":
+		return newHTTPConnectStreamDialerFromURL(innerDialer, configURL)
+	default:
+		return nil, fmt.Errorf("config scheme %v is not supported", configURL.Scheme)
+	}
+}
+
+// wrapPacketDialer wraps innerDialer according to configURL. controlStreamDialer is the
+// StreamDialer built from applying the same config chain up to this point, for transports (like
+// socks5's UDP ASSOCIATE) that need a TCP control connection alongside the packet path.
+func wrapPacketDialer(controlStreamDialer transport.StreamDialer, innerDialer transport.PacketDialer, configURL *url.URL) (transport.PacketDialer, error) {
+	switch strings.ToLower(configURL.Scheme) {
+	case "ss":
+		return newShadowsocksPacketDialerFromURL(innerDialer, configURL)
+	case "socks5":
+		return newSOCKS5PacketDialerFromURL(controlStreamDialer, innerDialer, configURL)
+	default:
+		return nil, fmt.Errorf("config scheme %v is not supported", configURL.Scheme)
+	}
+}
+
+// tcpDialer is the direct transport.StreamDialer used as the base of the dialer chain.
+type tcpDialer struct{}
+
+var _ transport.StreamDialer = (*tcpDialer)(nil)
+
+func (d *tcpDialer) DialStream(ctx context.Context, addr string) (transport.StreamConn, error) {
+	tracer := trace.FromContext(ctx)
+	if tracer.ConnectStart != nil {
+		tracer.ConnectStart("tcp", addr)
+	}
+	var netDialer net.Dialer
+	conn, err := netDialer.DialContext(ctx, "tcp", addr)
+	if tracer.ConnectDone != nil {
+		tracer.ConnectDone("tcp", addr, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.TCPConn), nil
+}
+
+// udpDialer is the direct transport.PacketDialer used as the base of the dialer chain.
+type udpDialer struct{}
+
+var _ transport.PacketDialer = (*udpDialer)(nil)
+
+func (d *udpDialer) DialPacket(ctx context.Context, addr string) (net.Conn, error) {
+	tracer := trace.FromContext(ctx)
+	if tracer.ConnectStart != nil {
+		tracer.ConnectStart("udp", addr)
+	}
+	var netDialer net.Dialer
+	conn, err := netDialer.DialContext(ctx, "udp", addr)
+	if tracer.ConnectDone != nil {
+		tracer.ConnectDone("udp", addr, err)
+	}
+	return conn, err
+}
@@ -0,0 +1,36 @@
+// Copyright 2023 Jigsaw Operations LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"net/url"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/transport/httpconnect"
+)
+
+func newHTTPConnectStreamDialerFromURL(innerDialer transport.StreamDialer, configURL *url.URL) (transport.StreamDialer, error) {
+	if configURL.Host == "" {
+		return nil, errors.New("host not specified")
+	}
+	endpoint := &transport.StreamDialerEndpoint{Dialer: innerDialer, Address: configURL.Host}
+	var username, password string
+	if configURL.User != nil {
+		username = configURL.User.Username()
+		password, _ = configURL.User.Password()
+	}
+	return httpconnect.NewStreamDialer(endpoint, username, password)
+}
@@ -0,0 +1,95 @@
+// Copyright 2023 Jigsaw Operations LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/x/httpfrag"
+)
+
+// newHTTPFragStreamDialerFromURL creates a transport.StreamDialer that mangles the Host header of
+// the first cleartext HTTP request written to the connection, as configured by configURL: either
+// "httpfrag://?split=host+N", which splits the header value N bytes in, or
+// "httpfrag://?case=mixed", which rewrites the header name with mixed case.
+func newHTTPFragStreamDialerFromURL(innerDialer transport.StreamDialer, configURL *url.URL) (transport.StreamDialer, error) {
+	newWriter, err := parseHTTPFragWriter(configURL)
+	if err != nil {
+		return nil, err
+	}
+	return &httpFragStreamDialer{inner: innerDialer, newWriter: newWriter}, nil
+}
+
+func parseHTTPFragWriter(configURL *url.URL) (func(io.Writer) *httpfrag.Writer, error) {
+	query := configURL.Query()
+	if splitStr := query.Get("split"); splitStr != "" {
+		offset, err := parseHostSplitOffset(splitStr)
+		if err != nil {
+			return nil, err
+		}
+		return func(w io.Writer) *httpfrag.Writer { return httpfrag.NewSplitWriter(w, offset) }, nil
+	}
+	if query.Get("case") != "" {
+		return func(w io.Writer) *httpfrag.Writer { return httpfrag.NewCaseWriter(w) }, nil
+	}
+	return nil, errors.New(`httpfrag requires a "split" or "case" query parameter, as in "httpfrag://?split=host+3"`)
+}
+
+func parseHostSplitOffset(split string) (int, error) {
+	const prefix = "host+"
+	// Query decoding turns an unescaped "+" into a space, so "split=host+3" arrives as "host 3".
+	split = strings.Replace(split, " ", "+", 1)
+	if !strings.HasPrefix(split, prefix) {
+		return 0, fmt.Errorf(`invalid httpfrag split %q: expected "host+N"`, split)
+	}
+	offset, err := strconv.Atoi(strings.TrimPrefix(split, prefix))
+	if err != nil {
+		return 0, fmt.Errorf("invalid httpfrag split offset %q: %w", split, err)
+	}
+	return offset, nil
+}
+
+type httpFragStreamDialer struct {
+	inner     transport.StreamDialer
+	newWriter func(io.Writer) *httpfrag.Writer
+}
+
+var _ transport.StreamDialer = (*httpFragStreamDialer)(nil)
+
+func (d *httpFragStreamDialer) DialStream(ctx context.Context, addr string) (transport.StreamConn, error) {
+	conn, err := d.inner.DialStream(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &httpFragConn{StreamConn: conn, writer: d.newWriter(conn)}, nil
+}
+
+// httpFragConn overrides the Write/ReadFrom path of the underlying transport.StreamConn so that
+// outbound data goes through an httpfrag.Writer, leaving reads untouched.
+type httpFragConn struct {
+	transport.StreamConn
+	writer *httpfrag.Writer
+}
+
+func (c *httpFragConn) Write(b []byte) (int, error) { return c.writer.Write(b) }
+
+func (c *httpFragConn) ReadFrom(r io.Reader) (int64, error) { return c.writer.ReadFrom(r) }
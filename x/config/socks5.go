@@ -0,0 +1,51 @@
+// Copyright 2023 Jigsaw Operations LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"net/url"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/transport/socks5"
+)
+
+func newSOCKS5StreamDialerFromURL(innerDialer transport.StreamDialer, configURL *url.URL) (transport.StreamDialer, error) {
+	if configURL.Host == "" {
+		return nil, errors.New("host not specified")
+	}
+	endpoint := &transport.StreamDialerEndpoint{Dialer: innerDialer, Address: configURL.Host}
+	return socks5.NewStreamDialer(endpoint, socks5CredentialsFromURL(configURL))
+}
+
+func newSOCKS5PacketDialerFromURL(innerStreamDialer transport.StreamDialer, innerPacketDialer transport.PacketDialer, configURL *url.URL) (transport.PacketDialer, error) {
+	if configURL.Host == "" {
+		return nil, errors.New("host not specified")
+	}
+	controlEndpoint := &transport.StreamDialerEndpoint{Dialer: innerStreamDialer, Address: configURL.Host}
+	listener, err := socks5.NewPacketListener(controlEndpoint, innerPacketDialer, socks5CredentialsFromURL(configURL))
+	if err != nil {
+		return nil, err
+	}
+	return transport.PacketListenerDialer{Listener: listener}, nil
+}
+
+func socks5CredentialsFromURL(configURL *url.URL) *socks5.Credentials {
+	if configURL.User == nil {
+		return nil
+	}
+	password, _ := configURL.User.Password()
+	return &socks5.Credentials{Username: configURL.User.Username(), Password: password}
+}
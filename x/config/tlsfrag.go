@@ -0,0 +1,155 @@
+// Copyright 2023 Jigsaw Operations LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	tlsrecordfrag "github.com/Jigsaw-Code/outline-sdk/transport/tls-record-frag"
+	"github.com/Jigsaw-Code/outline-sdk/transport/trace"
+)
+
+// newTLSFragStreamDialerFromURL creates a transport.StreamDialer that splits the first TLS
+// handshake record written to the connection, as configured by configURL. The prefix length can
+// be a fixed number of bytes, given either as the opaque part ("tlsfrag:5") or as a "prefix" query
+// parameter ("tlsfrag://?prefix=5"), or a range picked at random per connection via a "random"
+// query parameter ("tlsfrag://?random=1-3").
+func newTLSFragStreamDialerFromURL(innerDialer transport.StreamDialer, configURL *url.URL) (transport.StreamDialer, error) {
+	prefixBytes, err := parseTLSFragPrefix(configURL)
+	if err != nil {
+		return nil, err
+	}
+	return &tlsFragStreamDialer{inner: innerDialer, prefixBytes: prefixBytes}, nil
+}
+
+type tlsFragStreamDialer struct {
+	inner       transport.StreamDialer
+	prefixBytes func() int32
+}
+
+var _ transport.StreamDialer = (*tlsFragStreamDialer)(nil)
+
+func (d *tlsFragStreamDialer) DialStream(ctx context.Context, addr string) (transport.StreamConn, error) {
+	conn, err := d.inner.DialStream(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	prefixBytes := d.prefixBytes()
+	return &tlsFragConn{
+		StreamConn:  conn,
+		writer:      tlsrecordfrag.NewWriter(conn, prefixBytes),
+		tracer:      trace.FromContext(ctx),
+		serverName:  serverNameFromAddr(addr),
+		prefixBytes: prefixBytes,
+	}, nil
+}
+
+// tlsFragConn overrides the Write/ReadFrom path of the underlying transport.StreamConn so that
+// outbound data is fragmented by a tlsrecordfrag.Writer, leaving reads untouched. It reports the
+// split via the trace.Tracer attached to the dial context, if any, the first time it's written to.
+type tlsFragConn struct {
+	transport.StreamConn
+	writer interface {
+		io.Writer
+		io.ReaderFrom
+	}
+	tracer      *trace.Tracer
+	serverName  string
+	prefixBytes int32
+	traceOnce   sync.Once
+}
+
+func (c *tlsFragConn) Write(b []byte) (int, error) {
+	c.reportClientHello()
+	return c.writer.Write(b)
+}
+
+func (c *tlsFragConn) ReadFrom(r io.Reader) (int64, error) {
+	c.reportClientHello()
+	return c.writer.ReadFrom(r)
+}
+
+func (c *tlsFragConn) reportClientHello() {
+	c.traceOnce.Do(func() {
+		if c.tracer.TLSClientHello != nil {
+			c.tracer.TLSClientHello(c.serverName, c.prefixBytes)
+		}
+	})
+}
+
+func serverNameFromAddr(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+func parseTLSFragPrefix(configURL *url.URL) (func() int32, error) {
+	if configURL.Opaque != "" {
+		n, err := strconv.Atoi(configURL.Opaque)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tlsfrag prefix %q: %w", configURL.Opaque, err)
+		}
+		return fixedPrefix(n), nil
+	}
+	query := configURL.Query()
+	if randomRange := query.Get("random"); randomRange != "" {
+		return randomPrefix(randomRange)
+	}
+	prefixStr := query.Get("prefix")
+	if prefixStr == "" {
+		return nil, errors.New(`tlsfrag requires a prefix, as "tlsfrag:N", "tlsfrag://?prefix=N" or "tlsfrag://?random=min-max"`)
+	}
+	n, err := strconv.Atoi(prefixStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tlsfrag prefix %q: %w", prefixStr, err)
+	}
+	return fixedPrefix(n), nil
+}
+
+func fixedPrefix(n int) func() int32 {
+	return func() int32 { return int32(n) }
+}
+
+func randomPrefix(randomRange string) (func() int32, error) {
+	minStr, maxStr, ok := strings.Cut(randomRange, "-")
+	if !ok {
+		return nil, fmt.Errorf(`invalid tlsfrag random range %q: expected "min-max"`, randomRange)
+	}
+	min, err := strconv.Atoi(minStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tlsfrag random range %q: %w", randomRange, err)
+	}
+	max, err := strconv.Atoi(maxStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tlsfrag random range %q: %w", randomRange, err)
+	}
+	if max < min {
+		return nil, fmt.Errorf("invalid tlsfrag random range %q: max is less than min", randomRange)
+	}
+	span := int32(max-min) + 1
+	return func() int32 { return int32(min) + rand.Int31n(span) }, nil
+}
@@ -0,0 +1,143 @@
+// Copyright 2023 Jigsaw Operations LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net/url"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTLSFragPrefix(t *testing.T) {
+	tests := []struct {
+		name    string
+		rawURL  string
+		want    int32
+		wantErr bool
+	}{
+		{name: "opaque", rawURL: "tlsfrag:5", want: 5},
+		{name: "prefix query", rawURL: "tlsfrag://?prefix=7", want: 7},
+		{name: "missing prefix", rawURL: "tlsfrag://", wantErr: true},
+		{name: "invalid opaque", rawURL: "tlsfrag:abc", wantErr: true},
+		{name: "invalid prefix query", rawURL: "tlsfrag://?prefix=abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configURL, err := url.Parse(tt.rawURL)
+			require.NoError(t, err)
+			prefixBytes, err := parseTLSFragPrefix(configURL)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, prefixBytes())
+		})
+	}
+}
+
+func TestParseTLSFragPrefixRandom(t *testing.T) {
+	configURL, err := url.Parse("tlsfrag://?random=2-4")
+	require.NoError(t, err)
+	prefixBytes, err := parseTLSFragPrefix(configURL)
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		n := prefixBytes()
+		require.GreaterOrEqual(t, n, int32(2))
+		require.LessOrEqual(t, n, int32(4))
+	}
+}
+
+func TestParseTLSFragPrefixRandomInvalidRange(t *testing.T) {
+	configURL, err := url.Parse("tlsfrag://?random=4-2")
+	require.NoError(t, err)
+	_, err = parseTLSFragPrefix(configURL)
+	require.Error(t, err)
+}
+
+// fakeStreamConn is a minimal transport.StreamConn that records everything written to it.
+type fakeStreamConn struct {
+	transport.StreamConn
+	written bytes.Buffer
+}
+
+func (c *fakeStreamConn) Write(b []byte) (int, error) { return c.written.Write(b) }
+func (c *fakeStreamConn) CloseWrite() error            { return nil }
+func (c *fakeStreamConn) Close() error                 { return nil }
+
+type fakeStreamDialer struct {
+	conn *fakeStreamConn
+}
+
+var _ transport.StreamDialer = (*fakeStreamDialer)(nil)
+
+func (d *fakeStreamDialer) DialStream(ctx context.Context, addr string) (transport.StreamConn, error) {
+	return d.conn, nil
+}
+
+func makeRecord(recordType byte, payload []byte) []byte {
+	record := make([]byte, 5+len(payload))
+	record[0] = recordType
+	binary.BigEndian.PutUint16(record[3:], uint16(len(payload)))
+	copy(record[5:], payload)
+	return record
+}
+
+func TestTLSFragDialer_SplitsHandshakeRecord(t *testing.T) {
+	inner := &fakeStreamDialer{conn: &fakeStreamConn{}}
+	configURL, err := url.Parse("tlsfrag:3")
+	require.NoError(t, err)
+	dialer, err := newTLSFragStreamDialerFromURL(inner, configURL)
+	require.NoError(t, err)
+
+	conn, err := dialer.DialStream(context.Background(), "example.com:443")
+	require.NoError(t, err)
+
+	clientHello := makeRecord(22, []byte("0123456789"))
+	_, err = conn.Write(clientHello)
+	require.NoError(t, err)
+
+	written := inner.conn.written.Bytes()
+	// Two records, 5-byte header each, payload split 3/7.
+	require.Len(t, written, len(clientHello)+5)
+	require.Equal(t, byte(22), written[0])
+	require.Equal(t, uint16(3), binary.BigEndian.Uint16(written[3:5]))
+	require.Equal(t, "012", string(written[5:8]))
+	require.Equal(t, byte(22), written[8])
+	require.Equal(t, uint16(7), binary.BigEndian.Uint16(written[11:13]))
+	require.Equal(t, "3456789", string(written[13:]))
+}
+
+func TestTLSFragDialer_PassesThroughApplicationData(t *testing.T) {
+	inner := &fakeStreamDialer{conn: &fakeStreamConn{}}
+	configURL, err := url.Parse("tlsfrag:3")
+	require.NoError(t, err)
+	dialer, err := newTLSFragStreamDialerFromURL(inner, configURL)
+	require.NoError(t, err)
+
+	conn, err := dialer.DialStream(context.Background(), "example.com:443")
+	require.NoError(t, err)
+
+	appData := makeRecord(23, []byte("hello world"))
+	_, err = conn.Write(appData)
+	require.NoError(t, err)
+
+	require.Equal(t, appData, inner.conn.written.Bytes())
+}
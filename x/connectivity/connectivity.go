@@ -0,0 +1,122 @@
+// Copyright 2023 Jigsaw Operations LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package connectivity provides functions to test the connectivity of a
+// transport by resolving a test domain through it and reporting how the
+// attempt failed, if it did.
+package connectivity
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/miekg/dns"
+)
+
+// TestError wraps an error that happened during a connectivity test,
+// preserving the operation that failed and, when available, the POSIX
+// errno name, so callers that only see the error through a JSON record can
+// still tell network failures apart.
+type TestError struct {
+	// Op is the name of the operation that failed: "parse", "pack", "dial", "write" or "read".
+	Op string
+	// PosixError is the POSIX error name (e.g. "ECONNREFUSED"), or
+	// "EUNKNOWN" if it couldn't be determined.
+	PosixError string
+	Err        error
+}
+
+var _ error = (*TestError)(nil)
+
+func (err *TestError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *TestError) Unwrap() error {
+	return err.Err
+}
+
+func isTimeout(err error) bool {
+	var timeErr interface{ Timeout() bool }
+	return errors.As(err, &timeErr) && timeErr.Timeout()
+}
+
+func makeTestError(op string, err error) *TestError {
+	testErr := &TestError{Op: op, Err: err}
+	var errno syscall.Errno
+	switch {
+	case errors.As(err, &errno):
+		testErr.PosixError = errno.Error()
+	case isTimeout(err):
+		testErr.PosixError = "ETIMEDOUT"
+	default:
+		testErr.PosixError = "EUNKNOWN"
+	}
+	return testErr
+}
+
+// newTestQuery builds a minimal A query for testDomain with the Recursion
+// Desired bit set, the same query shape used by all of the TestResolver*
+// functions in this package.
+func newTestQuery(testDomain string) *dns.Msg {
+	q := new(dns.Msg)
+	q.SetQuestion(dns.Fqdn(testDomain), dns.TypeA)
+	q.RecursionDesired = true
+	return q
+}
+
+// TestResolverStreamConnectivity test the connectivity to a DNS resolver
+// over a transport.StreamEndpoint (DNS over TCP), resolving testDomain.
+// It returns the test duration and, if the resolution failed, a *TestError
+// describing what went wrong.
+func TestResolverStreamConnectivity(ctx context.Context, resolver transport.StreamEndpoint, testDomain string) (time.Duration, error) {
+	startTime := time.Now()
+	conn, err := resolver.Connect(ctx)
+	if err != nil {
+		return time.Since(startTime), makeTestError("dial", err)
+	}
+	defer conn.Close()
+	dnsConn := &dns.Conn{Conn: conn}
+	if err := dnsConn.WriteMsg(newTestQuery(testDomain)); err != nil {
+		return time.Since(startTime), makeTestError("write", err)
+	}
+	if _, err := dnsConn.ReadMsg(); err != nil {
+		return time.Since(startTime), makeTestError("read", err)
+	}
+	return time.Since(startTime), nil
+}
+
+// TestResolverPacketConnectivity test the connectivity to a DNS resolver
+// over a transport.PacketEndpoint (DNS over UDP), resolving testDomain.
+// It returns the test duration and, if the resolution failed, a *TestError
+// describing what went wrong.
+func TestResolverPacketConnectivity(ctx context.Context, resolver transport.PacketEndpoint, testDomain string) (time.Duration, error) {
+	startTime := time.Now()
+	conn, err := resolver.Connect(ctx)
+	if err != nil {
+		return time.Since(startTime), makeTestError("dial", err)
+	}
+	defer conn.Close()
+	dnsConn := &dns.Conn{Conn: conn}
+	if err := dnsConn.WriteMsg(newTestQuery(testDomain)); err != nil {
+		return time.Since(startTime), makeTestError("write", err)
+	}
+	if _, err := dnsConn.ReadMsg(); err != nil {
+		return time.Since(startTime), makeTestError("read", err)
+	}
+	return time.Since(startTime), nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2023 Jigsaw Operations LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectivity
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/miekg/dns"
+)
+
+// TestResolverDoHConnectivity tests the connectivity to a DNS-over-HTTPS
+// resolver, like "https://1.1.1.1/dns-query", resolving testDomain over a
+// TLS connection established via dialer. It returns the test duration and,
+// if the resolution failed, a *TestError describing what went wrong.
+func TestResolverDoHConnectivity(ctx context.Context, dialer transport.StreamDialer, resolverURL string, testDomain string) (time.Duration, error) {
+	startTime := time.Now()
+	host, addr, err := resolverHostAndAddress(resolverURL, "443")
+	if err != nil {
+		return time.Since(startTime), makeTestError("parse", err)
+	}
+	packed, err := newTestQuery(testDomain).Pack()
+	if err != nil {
+		return time.Since(startTime), makeTestError("pack", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, resolverURL, bytes.NewReader(packed))
+	if err != nil {
+		return time.Since(startTime), makeTestError("dial", err)
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	httpClient := &http.Client{
+		Transport: &http.Transport{
+			DialTLSContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialTLS(ctx, dialer, addr, host)
+			},
+		},
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return time.Since(startTime), makeTestError("write", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return time.Since(startTime), makeTestError("read", err)
+	}
+	var respMsg dns.Msg
+	if err := respMsg.Unpack(body); err != nil {
+		return time.Since(startTime), makeTestError("read", err)
+	}
+	return time.Since(startTime), nil
+}
+
+// TestResolverDoTConnectivity tests the connectivity to a DNS-over-TLS
+// resolver, like "tls://8.8.8.8:853", resolving testDomain over a TLS
+// connection established via dialer. It returns the test duration and, if
+// the resolution failed, a *TestError describing what went wrong.
+func TestResolverDoTConnectivity(ctx context.Context, dialer transport.StreamDialer, resolverURL string, testDomain string) (time.Duration, error) {
+	startTime := time.Now()
+	host, addr, err := resolverHostAndAddress(resolverURL, "853")
+	if err != nil {
+		return time.Since(startTime), makeTestError("parse", err)
+	}
+	tlsConn, err := dialTLS(ctx, dialer, addr, host)
+	if err != nil {
+		return time.Since(startTime), makeTestError("dial", err)
+	}
+	defer tlsConn.Close()
+	dnsConn := &dns.Conn{Conn: tlsConn}
+	if err := dnsConn.WriteMsg(newTestQuery(testDomain)); err != nil {
+		return time.Since(startTime), makeTestError("write", err)
+	}
+	if _, err := dnsConn.ReadMsg(); err != nil {
+		return time.Since(startTime), makeTestError("read", err)
+	}
+	return time.Since(startTime), nil
+}
+
+// resolverHostAndAddress extracts the TLS server name and "host:port" dial
+// address from a resolver URL, defaulting the port to defaultPort when the
+// URL doesn't specify one.
+func resolverHostAndAddress(resolverURL string, defaultPort string) (host, addr string, err error) {
+	u, err := url.Parse(resolverURL)
+	if err != nil {
+		return "", "", err
+	}
+	host = u.Hostname()
+	port := u.Port()
+	if port == "" {
+		port = defaultPort
+	}
+	return host, net.JoinHostPort(host, port), nil
+}
+
+// dialTLS dials addr via dialer and performs a TLS handshake over it,
+// verifying the server against host.
+func dialTLS(ctx context.Context, dialer transport.StreamDialer, addr, host string) (*tls.Conn, error) {
+	streamConn, err := dialer.DialStream(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	tlsConn := tls.Client(streamConn, &tls.Config{ServerName: host})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		streamConn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
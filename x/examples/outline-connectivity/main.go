@@ -26,9 +26,11 @@ import (
 	"os"
 	"path"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/transport/trace"
 	"github.com/Jigsaw-Code/outline-sdk/x/config"
 	"github.com/Jigsaw-Code/outline-sdk/x/connectivity"
 )
@@ -41,15 +43,42 @@ type jsonRecord struct {
 	// Inputs
 	Resolver string `json:"resolver"`
 	Proto    string `json:"proto"`
-	// TODO(fortuna): get details from trace
-	// Proxy    string `json:"proxy"`
-	// Prefix   string `json:"prefix"`
+	Proxy    string `json:"proxy,omitempty"`
+	Prefix   string `json:"prefix,omitempty"`
 	// Observations
 	Time       time.Time  `json:"time"`
 	DurationMs int64      `json:"duration_ms"`
 	Error      *errorJSON `json:"error"`
 }
 
+// hopTracer collects the first address dialed (the proxy, when the transport goes through one;
+// otherwise the resolver itself) and the TLS fragmentation prefix observed during a single
+// connectivity test, via the callbacks in trace.Tracer.
+type hopTracer struct {
+	mu          sync.Mutex
+	proxy       string
+	prefixBytes int32
+	hasPrefix   bool
+}
+
+func (h *hopTracer) tracer() *trace.Tracer {
+	return &trace.Tracer{
+		ConnectStart: func(network, addr string) {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			if h.proxy == "" {
+				h.proxy = addr
+			}
+		},
+		TLSClientHello: func(serverName string, prefixBytes int32) {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			h.prefixBytes = prefixBytes
+			h.hasPrefix = true
+		},
+	}
+}
+
 type errorJSON struct {
 	// TODO: add Shadowsocks/Transport error
 	Op string `json:"op,omitempty"`
@@ -96,8 +125,8 @@ func main() {
 	verboseFlag := flag.Bool("v", false, "Enable debug output")
 	transportFlag := flag.String("transport", "", "Transport config")
 	domainFlag := flag.String("domain", "example.com.", "Domain name to resolve in the test")
-	resolverFlag := flag.String("resolver", "8.8.8.8,2001:4860:4860::8888", "Comma-separated list of addresses of DNS resolver to use for the test")
-	protoFlag := flag.String("proto", "tcp,udp", "Comma-separated list of the protocols to test. Must be \"tcp\", \"udp\", or a combination of them")
+	resolverFlag := flag.String("resolver", "8.8.8.8,2001:4860:4860::8888", "Comma-separated list of addresses of DNS resolver to use for the test. For -proto doh or dot, these must be full resolver URLs, like \"https://1.1.1.1/dns-query\" or \"tls://8.8.8.8:853\"")
+	protoFlag := flag.String("proto", "tcp,udp", "Comma-separated list of the protocols to test. Must be \"tcp\", \"udp\", \"doh\", \"dot\", or a combination of them")
 
 	flag.Parse()
 	if *verboseFlag {
@@ -116,45 +145,63 @@ func main() {
 	jsonEncoder.SetEscapeHTML(false)
 	for _, resolverHost := range strings.Split(*resolverFlag, ",") {
 		resolverHost := strings.TrimSpace(resolverHost)
-		resolverAddress := net.JoinHostPort(resolverHost, "53")
 		for _, proto := range strings.Split(*protoFlag, ",") {
 			proto = strings.TrimSpace(proto)
 
 			testTime := time.Now()
 			var testErr error
 			var testDuration time.Duration
+			hops := &hopTracer{}
+			ctx := trace.WithTracer(context.Background(), hops.tracer())
 			switch proto {
 			case "tcp":
+				resolverAddress := net.JoinHostPort(resolverHost, "53")
 				streamDialer, err := config.NewStreamDialer(*transportFlag)
 				if err != nil {
 					log.Fatalf("Failed to create StreamDialer: %v", err)
 				}
 				resolver := &transport.StreamDialerEndpoint{Dialer: streamDialer, Address: resolverAddress}
-				testDuration, testErr = connectivity.TestResolverStreamConnectivity(context.Background(), resolver, *domainFlag)
+				testDuration, testErr = connectivity.TestResolverStreamConnectivity(ctx, resolver, *domainFlag)
 			case "udp":
+				resolverAddress := net.JoinHostPort(resolverHost, "53")
 				packetDialer, err := config.NewPacketDialer(*transportFlag)
 				if err != nil {
 					log.Fatalf("Failed to create PacketDialer: %v", err)
 				}
 				resolver := &transport.PacketDialerEndpoint{Dialer: packetDialer, Address: resolverAddress}
-				testDuration, testErr = connectivity.TestResolverPacketConnectivity(context.Background(), resolver, *domainFlag)
+				testDuration, testErr = connectivity.TestResolverPacketConnectivity(ctx, resolver, *domainFlag)
+			case "doh":
+				streamDialer, err := config.NewStreamDialer(*transportFlag)
+				if err != nil {
+					log.Fatalf("Failed to create StreamDialer: %v", err)
+				}
+				testDuration, testErr = connectivity.TestResolverDoHConnectivity(ctx, streamDialer, resolverHost, *domainFlag)
+			case "dot":
+				streamDialer, err := config.NewStreamDialer(*transportFlag)
+				if err != nil {
+					log.Fatalf("Failed to create StreamDialer: %v", err)
+				}
+				testDuration, testErr = connectivity.TestResolverDoTConnectivity(ctx, streamDialer, resolverHost, *domainFlag)
 			default:
-				log.Fatalf(`Invalid proto %v. Must be "tcp" or "udp"`, proto)
+				log.Fatalf(`Invalid proto %v. Must be "tcp", "udp", "doh" or "dot"`, proto)
 			}
 			debugLog.Printf("Test error: %v", testErr)
 			if testErr == nil {
 				success = true
 			}
 			record := jsonRecord{
-				Resolver: resolverAddress,
-				Proto:    proto,
-				Time:     testTime.UTC().Truncate(time.Second),
-				// TODO(fortuna): Add tracing to get more detailed info:
-				// Proxy:    proxyAddress,
-				// Prefix:   config.Prefix.String(),
+				Resolver:   resolverHost,
+				Proto:      proto,
+				Time:       testTime.UTC().Truncate(time.Second),
 				DurationMs: testDuration.Milliseconds(),
 				Error:      makeErrorRecord(testErr),
 			}
+			if hops.proxy != "" {
+				record.Proxy = hops.proxy
+			}
+			if hops.hasPrefix {
+				record.Prefix = fmt.Sprint(hops.prefixBytes)
+			}
 			err := jsonEncoder.Encode(record)
 			if err != nil {
 				log.Fatalf("Failed to output JSON: %v", err)
@@ -0,0 +1,129 @@
+// Copyright 2023 Jigsaw Operations LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package httpfrag implements an io.Writer that mangles the Host header of the first cleartext
+// HTTP request written to it, to defeat DPI that looks for a literal "Host:" header the same way
+// the tlsrecordfrag package defeats DPI that looks for a TLS ClientHello.
+package httpfrag
+
+import (
+	"bytes"
+	"io"
+)
+
+// Mode selects how the Host header is mangled.
+type Mode int
+
+const (
+	// ModeSplit splits the write in two at an offset within the Host header value, so the header
+	// is split across two separate writes to the underlying connection.
+	ModeSplit Mode = iota
+	// ModeCase rewrites the "Host" header name with mixed case (e.g. "hOsT"), which most HTTP
+	// servers still accept (header names are case-insensitive, RFC 9110 Section 5.1) but which
+	// defeats DPI that matches the header name as a literal, case-sensitive string.
+	ModeCase
+)
+
+var hostHeader = []byte("\r\nhost:")
+
+// mixedCaseHost is the replacement used by ModeCase. Its length must match len("Host").
+var mixedCaseHost = []byte("hOsT")
+
+// Writer splits or re-cases the Host header of the first HTTP request written to it, and passes
+// everything else through unmodified.
+type Writer struct {
+	writer      io.Writer
+	mode        Mode
+	splitOffset int
+	done        bool
+}
+
+// NewSplitWriter creates a Writer that splits the first request's Host header value splitOffset
+// bytes in, so the literal string "Host: <value>" never appears in a single write.
+func NewSplitWriter(writer io.Writer, splitOffset int) *Writer {
+	return &Writer{writer: writer, mode: ModeSplit, splitOffset: splitOffset}
+}
+
+// NewCaseWriter creates a Writer that rewrites the first request's "Host" header name with mixed
+// case.
+func NewCaseWriter(writer io.Writer) *Writer {
+	return &Writer{writer: writer, mode: ModeCase}
+}
+
+func (w *Writer) Write(data []byte) (int, error) {
+	if w.done {
+		return w.writer.Write(data)
+	}
+	w.done = true
+	nameIdx := findHostHeaderName(data)
+	if nameIdx < 0 {
+		return w.writer.Write(data)
+	}
+	if w.mode == ModeCase {
+		return w.writeCaseMangled(data, nameIdx)
+	}
+	return w.writeSplit(data, nameIdx+len("Host:"))
+}
+
+// ReadFrom lets Write's mangling apply to data copied in via io.Copy(w, source), the way
+// tlsrecordfrag.Writer.ReadFrom does for TLS records. On the first call it reads source to EOF
+// into memory before writing anything, since the Host header can appear anywhere in the request.
+func (w *Writer) ReadFrom(source io.Reader) (int64, error) {
+	if w.done {
+		return io.Copy(w.writer, source)
+	}
+	data, err := io.ReadAll(source)
+	if len(data) == 0 {
+		return 0, err
+	}
+	n, werr := w.Write(data)
+	if werr != nil {
+		return int64(n), werr
+	}
+	return int64(n), err
+}
+
+func (w *Writer) writeSplit(data []byte, valueStart int) (int, error) {
+	for valueStart < len(data) && data[valueStart] == ' ' {
+		valueStart++
+	}
+	splitAt := valueStart + w.splitOffset
+	if splitAt <= 0 || splitAt >= len(data) {
+		return w.writer.Write(data)
+	}
+	n1, err := w.writer.Write(data[:splitAt])
+	if err != nil {
+		return n1, err
+	}
+	n2, err := w.writer.Write(data[splitAt:])
+	return n1 + n2, err
+}
+
+func (w *Writer) writeCaseMangled(data []byte, nameIdx int) (int, error) {
+	mangled := make([]byte, len(data))
+	copy(mangled, data)
+	copy(mangled[nameIdx:nameIdx+len(mixedCaseHost)], mixedCaseHost)
+	return w.writer.Write(mangled)
+}
+
+// findHostHeaderName returns the index of the "Host" header's name in data, or -1 if it isn't
+// found. It requires the header to be preceded by a line break, so it won't match "Host:" if it
+// happens to appear in the request line or an earlier header's value.
+func findHostHeaderName(data []byte) int {
+	idx := bytes.Index(bytes.ToLower(data), hostHeader)
+	if idx < 0 {
+		return -1
+	}
+	return idx + len("\r\n")
+}
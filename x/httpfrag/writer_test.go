@@ -0,0 +1,128 @@
+// Copyright 2023 Jigsaw Operations LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpfrag
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const request = "GET / HTTP/1.1\r\nHost: example.com\r\nAccept: */*\r\n\r\n"
+
+func TestSplitWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewSplitWriter(&buf, 3)
+	n, err := w.Write([]byte(request))
+	require.NoError(t, err)
+	require.Equal(t, len(request), n)
+	require.Equal(t, request, buf.String())
+}
+
+func TestSplitWriter_SplitsAcrossWrites(t *testing.T) {
+	var writes [][]byte
+	w := NewSplitWriter(writeRecorder(&writes), 3)
+	_, err := w.Write([]byte(request))
+	require.NoError(t, err)
+	require.Len(t, writes, 2)
+	joined := string(writes[0]) + string(writes[1])
+	require.Equal(t, request, joined)
+	require.True(t, strings.HasSuffix(string(writes[0]), "exa"))
+}
+
+func TestSplitWriter_OffsetOutOfRange(t *testing.T) {
+	var writes [][]byte
+	w := NewSplitWriter(writeRecorder(&writes), 1000)
+	_, err := w.Write([]byte(request))
+	require.NoError(t, err)
+	require.Len(t, writes, 1)
+	require.Equal(t, request, string(writes[0]))
+}
+
+func TestSplitWriter_NoHostHeader(t *testing.T) {
+	var writes [][]byte
+	noHost := "GET / HTTP/1.1\r\nAccept: */*\r\n\r\n"
+	w := NewSplitWriter(writeRecorder(&writes), 3)
+	_, err := w.Write([]byte(noHost))
+	require.NoError(t, err)
+	require.Len(t, writes, 1)
+	require.Equal(t, noHost, string(writes[0]))
+}
+
+func TestSplitWriter_OnlyManglesFirstWrite(t *testing.T) {
+	var writes [][]byte
+	w := NewSplitWriter(writeRecorder(&writes), 3)
+	_, err := w.Write([]byte(request))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("more data with Host: not-mangled.com"))
+	require.NoError(t, err)
+	require.Len(t, writes, 3)
+	require.Equal(t, "more data with Host: not-mangled.com", string(writes[2]))
+}
+
+func TestCaseWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCaseWriter(&buf)
+	n, err := w.Write([]byte(request))
+	require.NoError(t, err)
+	require.Equal(t, len(request), n)
+	require.Contains(t, buf.String(), "\r\nhOsT: example.com\r\n")
+	require.NotContains(t, buf.String(), "\r\nHost:")
+}
+
+func TestCaseWriter_NoHostHeader(t *testing.T) {
+	var buf bytes.Buffer
+	noHost := "GET / HTTP/1.1\r\nAccept: */*\r\n\r\n"
+	w := NewCaseWriter(&buf)
+	_, err := w.Write([]byte(noHost))
+	require.NoError(t, err)
+	require.Equal(t, noHost, buf.String())
+}
+
+func TestWriter_ReadFrom(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCaseWriter(&buf)
+	n, err := w.ReadFrom(strings.NewReader(request))
+	require.NoError(t, err)
+	require.Equal(t, int64(len(request)), n)
+	require.Contains(t, buf.String(), "hOsT:")
+}
+
+func TestWriter_ReadFrom_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCaseWriter(&buf)
+	n, err := w.ReadFrom(strings.NewReader(""))
+	require.NoError(t, err)
+	require.Equal(t, int64(0), n)
+	require.Equal(t, "", buf.String())
+}
+
+// writeRecorder returns an io.Writer that appends a copy of each write to *writes.
+func writeRecorder(writes *[][]byte) *recordingWriter {
+	return &recordingWriter{writes: writes}
+}
+
+type recordingWriter struct {
+	writes *[][]byte
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	cp := make([]byte, len(p))
+	copy(cp, p)
+	*w.writes = append(*w.writes, cp)
+	return len(p), nil
+}
@@ -0,0 +1,212 @@
+// Copyright 2023 Jigsaw Operations LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sniproxy
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+const (
+	tlsDefaultPort  = "443"
+	httpDefaultPort = "80"
+
+	recordTypeHandshake      = 22
+	handshakeTypeClientHello = 1
+	extensionServerName      = 0
+
+	// maxPeekSize bounds how much of the connection we buffer to sniff the hostname. It must be
+	// large enough to hold the largest TLS record a conforming client sends (2^14 bytes, RFC 8446
+	// Section 5.1) plus its header, and large enough for a real-world HTTP header block, which routinely
+	// exceeds 4KB once post-quantum TLS key shares or long cookies are involved.
+	maxPeekSize = 64 * 1024
+)
+
+// peekConn is a net.Conn wrapper that lets us read the bytes used to sniff
+// the hostname (the ClientHello or the first HTTP request line) and then
+// replay them to whoever reads from the connection next, so the original
+// bytes reach the target dialer unmodified.
+type peekConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *peekConn) Read(b []byte) (int, error) { return c.r.Read(b) }
+
+// CloseWrite implements transport.StreamConn by delegating to the
+// underlying connection, which is always a *net.TCPConn in practice.
+func (c *peekConn) CloseWrite() error {
+	type writeCloser interface {
+		CloseWrite() error
+	}
+	if wc, ok := c.Conn.(writeCloser); ok {
+		return wc.CloseWrite()
+	}
+	return c.Conn.Close()
+}
+
+// sniffHostname peeks at conn to determine the hostname the client is
+// trying to reach, without consuming any bytes the target connection will
+// need. It returns a net.Conn that replays the peeked bytes followed by the
+// rest of the stream, and the "hostname:port" the connection should be
+// forwarded to.
+func sniffHostname(conn net.Conn) (addr string, pconn transport.StreamConn, err error) {
+	// A plain bufio.NewReader caps Peek at its default 4096-byte buffer, which is smaller than a
+	// routine TLS ClientHello (e.g. one carrying a post-quantum key share) or a large HTTP header
+	// block, so size the buffer to the largest peek we'll ever attempt.
+	r := bufio.NewReaderSize(conn, maxPeekSize)
+	pconn = &peekConn{Conn: conn, r: r}
+
+	peeked, err := r.Peek(5)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to peek record header: %w", err)
+	}
+	if peeked[0] == recordTypeHandshake {
+		hostname, err := sniffTLSServerName(r)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to read SNI: %w", err)
+		}
+		return net.JoinHostPort(hostname, tlsDefaultPort), pconn, nil
+	}
+	hostname, err := sniffHTTPHost(r)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read HTTP Host header: %w", err)
+	}
+	return net.JoinHostPort(hostname, httpDefaultPort), pconn, nil
+}
+
+// sniffTLSServerName parses just enough of a TLS ClientHello to extract the
+// server_name extension (RFC 8446, Section 4.2.11), using only Peek calls so
+// the handshake record is left intact in r for the target dialer.
+func sniffTLSServerName(r *bufio.Reader) (string, error) {
+	header, err := r.Peek(5)
+	if err != nil {
+		return "", err
+	}
+	recordLen := int(header[3])<<8 | int(header[4])
+	record, err := r.Peek(5 + recordLen)
+	if err != nil {
+		return "", err
+	}
+	body := record[5:]
+	if len(body) < 4 || body[0] != handshakeTypeClientHello {
+		return "", errors.New("not a ClientHello")
+	}
+	// Skip handshake header (1), length (3), version (2), random (32).
+	pos := 1 + 3 + 2 + 32
+	if pos >= len(body) {
+		return "", errors.New("truncated ClientHello")
+	}
+	// Session ID.
+	sessionIDLen := int(body[pos])
+	pos += 1 + sessionIDLen
+	if pos+2 > len(body) {
+		return "", errors.New("truncated ClientHello")
+	}
+	// Cipher suites.
+	cipherSuitesLen := int(body[pos])<<8 | int(body[pos+1])
+	pos += 2 + cipherSuitesLen
+	if pos+1 > len(body) {
+		return "", errors.New("truncated ClientHello")
+	}
+	// Compression methods.
+	compressionMethodsLen := int(body[pos])
+	pos += 1 + compressionMethodsLen
+	if pos+2 > len(body) {
+		return "", errors.New("no extensions")
+	}
+	extensionsLen := int(body[pos])<<8 | int(body[pos+1])
+	pos += 2
+	end := pos + extensionsLen
+	if end > len(body) {
+		return "", errors.New("truncated extensions")
+	}
+	for pos+4 <= end {
+		extType := int(body[pos])<<8 | int(body[pos+1])
+		extLen := int(body[pos+2])<<8 | int(body[pos+3])
+		pos += 4
+		if pos+extLen > end {
+			return "", errors.New("truncated extension")
+		}
+		if extType == extensionServerName {
+			return parseServerNameExtension(body[pos : pos+extLen])
+		}
+		pos += extLen
+	}
+	return "", errors.New("no server_name extension")
+}
+
+func parseServerNameExtension(ext []byte) (string, error) {
+	// struct { ServerName server_name_list<1..2^16-1> } ServerNameList
+	if len(ext) < 2 {
+		return "", errors.New("malformed server_name extension")
+	}
+	listLen := int(ext[0])<<8 | int(ext[1])
+	pos := 2
+	end := pos + listLen
+	if end > len(ext) {
+		end = len(ext)
+	}
+	for pos+3 <= end {
+		nameType := ext[pos]
+		nameLen := int(ext[pos+1])<<8 | int(ext[pos+2])
+		pos += 3
+		if pos+nameLen > end {
+			break
+		}
+		if nameType == 0 { // host_name
+			return string(ext[pos : pos+nameLen]), nil
+		}
+		pos += nameLen
+	}
+	return "", errors.New("no host_name in server_name extension")
+}
+
+// sniffHTTPHost peeks at a cleartext HTTP request and returns its Host
+// header, leaving the request itself unread in r.
+func sniffHTTPHost(r *bufio.Reader) (string, error) {
+	for n := 512; ; n *= 2 {
+		if n > maxPeekSize {
+			return "", errors.New("request headers too large")
+		}
+		peeked, err := r.Peek(n)
+		if len(peeked) == 0 && err != nil {
+			return "", err
+		}
+		if idx := bytes.Index(peeked, []byte("\r\n\r\n")); idx >= 0 || err != nil {
+			req, rerr := http.ReadRequest(bufio.NewReader(bytes.NewReader(peeked)))
+			if rerr != nil {
+				if idx < 0 {
+					continue
+				}
+				return "", rerr
+			}
+			host := req.Host
+			if host == "" {
+				return "", errors.New("no Host header")
+			}
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			return host, nil
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2023 Jigsaw Operations LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sniproxy
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// makeClientHello builds a minimal-but-valid TLS ClientHello handshake record carrying a
+// server_name extension, padded with a padding extension so the record can be grown past
+// the default 4096-byte bufio.Reader size, the way a real ClientHello with a post-quantum hybrid
+// key share routinely does.
+func makeClientHello(serverName string, padLen int) []byte {
+	var serverNameExt []byte
+	{
+		name := []byte(serverName)
+		entry := append([]byte{0, byte(len(name) >> 8), byte(len(name))}, name...)
+		list := append([]byte{byte((len(entry)) >> 8), byte(len(entry))}, entry...)
+		serverNameExt = append([]byte{0, extensionServerName, byte(len(list) >> 8), byte(len(list))}, list...)
+	}
+
+	padExt := make([]byte, 4+padLen)
+	binary.BigEndian.PutUint16(padExt[0:2], 21) // extension type "padding"
+	binary.BigEndian.PutUint16(padExt[2:4], uint16(padLen))
+
+	extensions := append(append([]byte{}, serverNameExt...), padExt...)
+
+	var body []byte
+	body = append(body, handshakeTypeClientHello, 0, 0, 0) // handshake header, length patched below
+	body = append(body, 3, 3)                              // legacy_version
+	body = append(body, make([]byte, 32)...)               // random
+	body = append(body, 0)                                 // session_id length
+	body = append(body, 0, 2, 0x13, 0x01)                  // cipher_suites
+	body = append(body, 1, 0)                              // compression_methods
+	body = append(body, byte(len(extensions)>>8), byte(len(extensions)))
+	body = append(body, extensions...)
+
+	handshakeLen := len(body) - 4
+	body[1] = byte(handshakeLen >> 16)
+	body[2] = byte(handshakeLen >> 8)
+	body[3] = byte(handshakeLen)
+
+	record := make([]byte, 5+len(body))
+	record[0] = recordTypeHandshake
+	record[1], record[2] = 3, 3
+	binary.BigEndian.PutUint16(record[3:5], uint16(len(body)))
+	copy(record[5:], body)
+	return record
+}
+
+func TestSniffHostname_LargeClientHello(t *testing.T) {
+	// Pad the record well past the default 4096-byte bufio.Reader buffer, matching the size of a
+	// real-world ClientHello carrying a post-quantum hybrid key share.
+	clientHello := makeClientHello("example.com", 8192)
+	require.Greater(t, len(clientHello), 4096)
+
+	client, server := net.Pipe()
+	go func() {
+		client.Write(clientHello)
+		client.Close()
+	}()
+
+	addr, _, err := sniffHostname(server)
+	require.NoError(t, err)
+	require.Equal(t, "example.com:443", addr)
+}
+
+func TestSniffHostname_HTTPRequest(t *testing.T) {
+	request := "GET / HTTP/1.1\r\nHost: example.org\r\nUser-Agent: test\r\n\r\n"
+
+	client, server := net.Pipe()
+	go func() {
+		client.Write([]byte(request))
+		client.Close()
+	}()
+
+	addr, _, err := sniffHostname(server)
+	require.NoError(t, err)
+	require.Equal(t, "example.org:80", addr)
+}
@@ -0,0 +1,173 @@
+// Copyright 2023 Jigsaw Operations LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sniproxy implements a TCP listener that inspects the SNI of an
+// incoming TLS handshake (or the Host header of a cleartext HTTP request)
+// and dispatches the connection to one of several transport.StreamDialers,
+// selected by hostname. It's modeled after the routing table in
+// github.com/inetaf/tcpproxy, but the downstream leg is an Outline
+// transport.StreamDialer instead of a plain net.Dialer, so each route can be
+// its own transport (Shadowsocks, direct, etc.).
+package sniproxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// ErrNoRoute is returned when no route matches a connection and no default
+// route has been configured.
+var ErrNoRoute = errors.New("sniproxy: no route for hostname")
+
+type route struct {
+	match  func(hostname string) bool
+	dialer transport.StreamDialer
+}
+
+// Proxy accepts connections on a net.Listener and forwards each one to a
+// transport.StreamDialer chosen by matching the connection's SNI (for TLS)
+// or Host header (for cleartext HTTP) against the registered routes.
+//
+// Proxy is safe for concurrent use. Routes may be registered before or after
+// Serve is called; routes added afterwards are honored by connections
+// accepted from that point on.
+type Proxy struct {
+	// ErrorLog, if non-nil, is used to log per-connection errors instead of
+	// the standard logger.
+	ErrorLog *log.Logger
+
+	mu            sync.RWMutex
+	routes        []route
+	defaultDialer transport.StreamDialer
+}
+
+// NewProxy creates a Proxy with no routes configured. Use AddSNIRoute,
+// AddSNIMatchRoute and SetDefaultRoute to populate it before calling Serve.
+func NewProxy() *Proxy {
+	return &Proxy{}
+}
+
+// AddSNIRoute routes connections whose SNI or Host header is exactly
+// hostname (case-insensitive) to dialer.
+func (p *Proxy) AddSNIRoute(hostname string, dialer transport.StreamDialer) {
+	hostname = strings.ToLower(hostname)
+	p.addRoute(func(h string) bool { return h == hostname }, dialer)
+}
+
+// AddSNIMatchRoute routes connections whose SNI or Host header matches re to
+// dialer. Routes are tried in the order they were added, and the first match
+// wins.
+func (p *Proxy) AddSNIMatchRoute(re *regexp.Regexp, dialer transport.StreamDialer) {
+	p.addRoute(re.MatchString, dialer)
+}
+
+// SetDefaultRoute sets the dialer used for connections that don't match any
+// route added via AddSNIRoute or AddSNIMatchRoute. Without a default route,
+// unmatched connections are closed.
+func (p *Proxy) SetDefaultRoute(dialer transport.StreamDialer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.defaultDialer = dialer
+}
+
+func (p *Proxy) addRoute(match func(string) bool, dialer transport.StreamDialer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.routes = append(p.routes, route{match, dialer})
+}
+
+func (p *Proxy) dialerFor(hostname string) transport.StreamDialer {
+	hostname = strings.ToLower(hostname)
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, r := range p.routes {
+		if r.match(hostname) {
+			return r.dialer
+		}
+	}
+	return p.defaultDialer
+}
+
+// Serve accepts connections from ln until it returns an error, dispatching
+// each one to its matched dialer in its own goroutine. Serve blocks until
+// Accept returns any error, such as when ln is closed, and returns that error.
+func (p *Proxy) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go p.handle(conn)
+	}
+}
+
+func (p *Proxy) handle(conn net.Conn) {
+	defer conn.Close()
+	addr, pconn, err := sniffHostname(conn)
+	if err != nil {
+		p.logf("sniproxy: failed to read hostname from %v: %v", conn.RemoteAddr(), err)
+		return
+	}
+	hostname, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		hostname = addr
+	}
+	dialer := p.dialerFor(hostname)
+	if dialer == nil {
+		p.logf("sniproxy: %v: %v", hostname, ErrNoRoute)
+		return
+	}
+	targetConn, err := dialer.DialStream(context.Background(), addr)
+	if err != nil {
+		p.logf("sniproxy: failed to dial %v for %v: %v", addr, conn.RemoteAddr(), err)
+		return
+	}
+	defer targetConn.Close()
+	relay(pconn, targetConn)
+}
+
+func (p *Proxy) logf(format string, args ...any) {
+	if p.ErrorLog != nil {
+		p.ErrorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// relay copies data between the client and target connections in both
+// directions and returns once both directions are done, mirroring the pattern used by io-based proxies like
+// inetaf/tcpproxy.
+func relay(client, target transport.StreamConn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		io.Copy(target, client)
+		target.CloseWrite()
+	}()
+	go func() {
+		defer wg.Done()
+		io.Copy(client, target)
+		client.CloseWrite()
+	}()
+	wg.Wait()
+}